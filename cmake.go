@@ -0,0 +1,293 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// cmake_target records what a single CMakeLists.txt call told us about one
+// build target: its include search paths, split by whether they propagate
+// to targets that link against it, and the other targets it links. A plain
+// directory-scoped include_directories() call is represented the same way
+// with an empty name.
+type cmake_target struct {
+	name           string
+	component_path string
+	private_dirs   []string // PRIVATE dirs and plain include_directories(): local to this component only
+	public_dirs    []string // PUBLIC/INTERFACE dirs: propagate to anything linking this target
+	links          []string // target names passed to target_link_libraries for this target
+}
+
+// parse_cmakelists does a light, non-evaluating scan of a CMakeLists.txt
+// for add_library/add_executable, target_include_directories,
+// include_directories and target_link_libraries calls. It understands
+// ${CMAKE_CURRENT_SOURCE_DIR}/${CMAKE_CURRENT_LIST_DIR} substitution but
+// nothing else from CMake's variable or control-flow language - this is a
+// dependency scanner, not a CMake interpreter.
+func parse_cmakelists(cmakelists_path string, component_path string) ([]cmake_target, error) {
+	content, err := os.ReadFile(cmakelists_path)
+	if err != nil {
+		return nil, err
+	}
+	text := string(content)
+
+	var targets []cmake_target
+
+	for _, kind := range []string{"add_library", "add_executable"} {
+		for _, call := range extract_calls(text, kind) {
+			if name := parse_target_name(call); name != "" {
+				targets = append(targets, cmake_target{name: name, component_path: component_path})
+			}
+		}
+	}
+
+	for _, call := range extract_calls(text, "target_include_directories") {
+		target, private_dirs, public_dirs := parse_target_include_directories(call, component_path)
+		if target != "" {
+			targets = append(targets, cmake_target{
+				name:           target,
+				component_path: component_path,
+				private_dirs:   private_dirs,
+				public_dirs:    public_dirs,
+			})
+		}
+	}
+
+	for _, call := range extract_calls(text, "include_directories") {
+		if dirs := parse_include_directories(call, component_path); len(dirs) > 0 {
+			targets = append(targets, cmake_target{component_path: component_path, private_dirs: dirs})
+		}
+	}
+
+	for _, call := range extract_calls(text, "target_link_libraries") {
+		target, links := parse_target_link_libraries(call)
+		if target != "" && len(links) > 0 {
+			targets = append(targets, cmake_target{name: target, component_path: component_path, links: links})
+		}
+	}
+
+	return targets, nil
+}
+
+// resolve_cmake_include_dirs computes each component's effective include
+// search path from the target_include_directories/include_directories
+// calls collected while walking the project, propagating PUBLIC/INTERFACE
+// directories transitively across target_link_libraries edges. It assumes
+// a target_link_libraries call names targets declared in the same
+// CMakeLists.txt it appears in, which holds for the common
+// one-target-per-directory layout.
+func (p *project) resolve_cmake_include_dirs() {
+	target_component := make(map[string]string)
+	for _, t := range p.cmake_targets {
+		if t.name != "" {
+			target_component[t.name] = t.component_path
+		}
+	}
+
+	own := make(map[string][]string)
+	public := make(map[string][]string)
+	links := make(map[string][]string)
+	for _, t := range p.cmake_targets {
+		own[t.component_path] = append(own[t.component_path], t.private_dirs...)
+		public[t.component_path] = append(public[t.component_path], t.public_dirs...)
+		for _, link_name := range t.links {
+			if dep_component, ok := target_component[link_name]; ok && dep_component != t.component_path {
+				links[t.component_path] = append(links[t.component_path], dep_component)
+			}
+		}
+	}
+
+	for i := range p.components {
+		c := &p.components[i]
+		dirs := append([]string{}, own[c.path]...)
+		dirs = append(dirs, public[c.path]...)
+
+		seen := map[string]bool{c.path: true}
+		queue := append([]string{}, links[c.path]...)
+		for len(queue) > 0 {
+			dep := queue[0]
+			queue = queue[1:]
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			dirs = append(dirs, public[dep]...)
+			queue = append(queue, links[dep]...)
+		}
+		c.include_dirs = dirs
+	}
+}
+
+// resolve_include finds the files an #include resolves to. When f's
+// component declares CMake include directories, it walks them in order and
+// returns the first one under which the include is a known project file.
+// Otherwise (or if none of the search paths match) it falls back to the
+// suffix heuristic of treating any path ending in the include as a
+// candidate.
+func resolve_include(f file, include string, path_to_files map[string][]*file) ([]*file, bool) {
+	if f.component != nil {
+		for _, dir := range f.component.include_dirs {
+			if deps, ok := path_to_files[path.Join(dir, include)]; ok {
+				return deps, true
+			}
+		}
+		if len(f.component.include_dirs) > 0 {
+			return nil, false
+		}
+	}
+	deps, ok := path_to_files[include]
+	return deps, ok
+}
+
+// extract_calls finds every invocation of the given CMake command in
+// content and returns the raw text between its parentheses, one entry per
+// call. It balances parentheses but otherwise doesn't parse CMake syntax.
+func extract_calls(content, name string) []string {
+	var calls []string
+	search := name + "("
+
+	for i := 0; i <= len(content)-len(search); {
+		idx := strings.Index(content[i:], search)
+		if idx == -1 {
+			break
+		}
+		call_start := i + idx
+		if call_start > 0 && is_ident_byte(content[call_start-1]) {
+			i = call_start + 1
+			continue
+		}
+
+		start := call_start + len(search)
+		depth := 1
+		j := start
+		for j < len(content) && depth > 0 {
+			switch content[j] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			j++
+		}
+		calls = append(calls, content[start:j-1])
+		i = j
+	}
+	return calls
+}
+
+func is_ident_byte(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
+
+// tokenize_cmake_args splits a CMake call's argument text on whitespace,
+// keeping double-quoted segments together.
+func tokenize_cmake_args(raw string) []string {
+	var tokens []string
+	var current strings.Builder
+	in_quotes := false
+
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range raw {
+		switch {
+		case r == '"':
+			in_quotes = !in_quotes
+		case !in_quotes && (r == ' ' || r == '\t' || r == '\n' || r == '\r'):
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+func parse_target_name(call string) string {
+	tokens := tokenize_cmake_args(call)
+	if len(tokens) == 0 {
+		return ""
+	}
+	return tokens[0]
+}
+
+// parse_target_include_directories parses
+// target_include_directories(<target> [PUBLIC|PRIVATE|INTERFACE dirs]...).
+// A directory given before any scope keyword is treated as PRIVATE.
+func parse_target_include_directories(call string, component_path string) (target string, private_dirs, public_dirs []string) {
+	tokens := tokenize_cmake_args(call)
+	if len(tokens) == 0 {
+		return "", nil, nil
+	}
+	target = tokens[0]
+
+	scope := "PRIVATE"
+	for _, tok := range tokens[1:] {
+		switch tok {
+		case "PUBLIC", "PRIVATE", "INTERFACE":
+			scope = tok
+		default:
+			dir := resolve_cmake_dir(tok, component_path)
+			if scope == "PRIVATE" {
+				private_dirs = append(private_dirs, dir)
+			} else {
+				public_dirs = append(public_dirs, dir)
+			}
+		}
+	}
+	return target, private_dirs, public_dirs
+}
+
+// parse_include_directories parses the legacy directory-scoped
+// include_directories([AFTER|BEFORE] [SYSTEM] dirs...) call.
+func parse_include_directories(call string, component_path string) []string {
+	var dirs []string
+	for _, tok := range tokenize_cmake_args(call) {
+		switch tok {
+		case "AFTER", "BEFORE", "SYSTEM":
+			continue
+		}
+		dirs = append(dirs, resolve_cmake_dir(tok, component_path))
+	}
+	return dirs
+}
+
+// parse_target_link_libraries parses
+// target_link_libraries(<target> [PUBLIC|PRIVATE|INTERFACE libs]...),
+// ignoring the scope keywords: any link grants access to the linked
+// target's PUBLIC/INTERFACE include directories.
+func parse_target_link_libraries(call string) (target string, links []string) {
+	tokens := tokenize_cmake_args(call)
+	if len(tokens) == 0 {
+		return "", nil
+	}
+	target = tokens[0]
+	for _, tok := range tokens[1:] {
+		switch tok {
+		case "PUBLIC", "PRIVATE", "INTERFACE":
+			continue
+		}
+		links = append(links, tok)
+	}
+	return target, links
+}
+
+// resolve_cmake_dir turns a raw directory argument into a project-relative
+// path. ${CMAKE_CURRENT_SOURCE_DIR} and ${CMAKE_CURRENT_LIST_DIR} are
+// substituted with component_path; anything else is assumed relative to
+// component_path, matching CMake's own default.
+func resolve_cmake_dir(raw string, component_path string) string {
+	had_var := strings.Contains(raw, "${CMAKE_CURRENT_SOURCE_DIR}") || strings.Contains(raw, "${CMAKE_CURRENT_LIST_DIR}")
+	dir := strings.ReplaceAll(raw, "${CMAKE_CURRENT_SOURCE_DIR}", component_path)
+	dir = strings.ReplaceAll(dir, "${CMAKE_CURRENT_LIST_DIR}", component_path)
+
+	if had_var {
+		return path.Clean(dir)
+	}
+	return path.Clean(path.Join(component_path, dir))
+}
@@ -20,6 +20,17 @@ type log_flags struct {
 	warn_malformed bool
 	show_incoming  bool
 	show_outgoing  bool
+	format         string
+	one_line       bool
+	sort_deps      bool
+	all_deps       bool
+	cycles         bool
+	macros         map[string]string
+	strict_preproc bool
+	rules_path     string
+	rules_json     bool
+	granularity    string
+	cluster        bool
 }
 
 func main() {
@@ -28,6 +39,19 @@ func main() {
 	warn_malformed := flag.Bool("warn-malformed", false, "warn about malformed includes")
 	show_incoming := flag.Bool("show-incoming", false, "show files for incoming dependencies")
 	show_outgoing := flag.Bool("show-outgoing", false, "show files for outgoing dependencies")
+	format := flag.String("format", "text", "output format: \"text\", \"make\", \"dot\", or \"json\"")
+	one_line := flag.Bool("one-line", false, "with -format=make, keep each rule on a single line")
+	sort_deps := flag.Bool("sort", false, "with -format=make, emit rules in topological order")
+	all_deps := flag.Bool("all", false, "with -format=make, include transitive header dependencies")
+	cycles := flag.Bool("cycles", false, "detect and report component-level dependency cycles")
+	var macros macro_flag
+	flag.Var(&macros, "D", "define a macro as NAME or NAME=value for preprocessor evaluation (repeatable)")
+	strict_preproc := flag.Bool("strict-preproc", false,
+		"drop #include lines behind an #if/#ifdef that can't be evaluated, instead of conservatively keeping them")
+	rules_path := flag.String("rules", "", "path to a YAML layering rules file enforcing allowed/forbidden component dependencies")
+	rules_json := flag.Bool("rules-json", false, "with -rules, emit violations as JSON instead of text")
+	granularity := flag.String("granularity", "component", "with -format=dot, graph granularity: \"component\" or \"file\"")
+	cluster := flag.Bool("cluster", false, "with -format=dot, cluster component nodes by top-level directory")
 	flag.Parse()
 
 	flags := log_flags{
@@ -35,12 +59,61 @@ func main() {
 		warn_missing:   *warn_missing,
 		warn_malformed: *warn_malformed,
 		show_incoming:  *show_incoming,
-		show_outgoing:  *show_outgoing}
+		show_outgoing:  *show_outgoing,
+		format:         *format,
+		one_line:       *one_line,
+		sort_deps:      *sort_deps,
+		all_deps:       *all_deps,
+		cycles:         *cycles,
+		macros:         macros.values,
+		strict_preproc: *strict_preproc,
+		rules_path:     *rules_path,
+		rules_json:     *rules_json,
+		granularity:    *granularity,
+		cluster:        *cluster}
 
 	project := read_files(*root_dir, flags)
 	project.assign_files_to_components()
 	project.generate_file_deps(flags)
-	project.print_components(flags)
+	switch flags.format {
+	case "make":
+		project.print_make(flags)
+	case "dot":
+		if flags.granularity == "file" {
+			project.print_dot_files(flags)
+		} else {
+			project.print_dot(flags)
+		}
+	case "json":
+		project.print_json(flags)
+	default:
+		project.print_components(flags)
+	}
+	if flags.cycles {
+		_, sccs, err := project.topological_order()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cppdep: %v\n", err)
+			os.Exit(1)
+		}
+		project.print_cycles(sccs)
+	}
+	project.print_unused_ignores()
+	if flags.rules_path != "" {
+		cfg, err := load_layering_rules(flags.rules_path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cppdep: %v\n", err)
+			os.Exit(1)
+		}
+		violations := project.layering_violations(cfg)
+		if flags.rules_json {
+			print_layering_violations_json(violations)
+		} else {
+			print_layering_violations(violations)
+		}
+		if len(violations) > 0 {
+			os.Exit(1)
+		}
+	}
 	//project.dbg_files()
 }
 
@@ -51,6 +124,12 @@ type file struct {
 	component      *component
 	incoming_links []*file
 	outgoing_links []*file
+
+	// build_deps holds every file f resolves an #include to, including
+	// includes that resolve within f's own component (which outgoing_links
+	// omits, see generate_file_deps). This is what -format=make builds
+	// prerequisite lists from.
+	build_deps []*file
 }
 
 func (f *file) print() {
@@ -74,8 +153,9 @@ func (f *file) print() {
 }
 
 type component struct {
-	path  string
-	files []*file
+	path         string
+	files        []*file
+	include_dirs []string // effective CMake include search paths, in resolution order
 }
 
 func (c *component) nice_name() string {
@@ -161,9 +241,11 @@ func (c *component) print(flags log_flags) {
 }
 
 type project struct {
-	root       string
-	files      []file
-	components []component
+	root          string
+	files         []file
+	components    []component
+	ignores       []*ignore_rule
+	cmake_targets []cmake_target
 }
 
 func (p *project) rel_path(path string) string {
@@ -173,19 +255,27 @@ func (p *project) rel_path(path string) string {
 
 func (p *project) print_components(flags log_flags) {
 	for _, c := range p.components {
-		should_print := len(flags.components) == 0
-		for _, name := range flags.components {
-			if name == c.nice_name() {
-				should_print = true
-				break
-			}
-		}
-		if should_print {
+		if should_print_component(c, flags.components) {
 			c.print(flags)
 		}
 	}
 }
 
+// should_print_component reports whether c passes the component-filter
+// arguments shared by every output mode: with no names given, everything
+// passes; otherwise c must match one of them by its nice_name().
+func should_print_component(c component, names []string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	for _, name := range names {
+		if name == c.nice_name() {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *project) print_files() {
 	for _, f := range p.files {
 		f.print()
@@ -237,33 +327,44 @@ func (p *project) generate_file_deps(flags log_flags) {
 
 	for i_file, file := range p.files {
 		for _, include := range file.include_paths {
-			deps, present := path_to_files[include]
-			if present {
-				// If a file can be included from the current solution, assume that it is.
-				// This avoids adding dependencies to headers with name clashes (like StdAfx.h).
-				is_present_in_this_component := false
-				for _, dep := range deps {
-					if dep.component == file.component {
-						is_present_in_this_component = true
-						break
-					}
+			deps, present := resolve_include(file, include, path_to_files)
+			if !present {
+				if flags.warn_missing {
+					fmt.Printf("Include not found in %s: %s\n", file.path, include)
 				}
-				if !is_present_in_this_component {
-					for _, dep := range deps {
-						p.files[i_file].outgoing_links =
-							append(p.files[i_file].outgoing_links, dep)
-
-						dep.incoming_links =
-							append(dep.incoming_links, &p.files[i_file])
-					}
-				}
-			} else if flags.warn_missing {
-				fmt.Printf("Include not found in %s: %s\n", file.path, include)
+				continue
+			}
+
+			// If a file can be included from the current solution, assume that it is.
+			// This avoids adding cross-component dependencies for headers with name
+			// clashes (like StdAfx.h): a same-component match always wins. It's still
+			// a real prerequisite for -format=make, so it goes into build_deps either way.
+			same_component := same_component_dep(deps, file.component)
+			if same_component != nil {
+				p.files[i_file].build_deps = append(p.files[i_file].build_deps, same_component)
+				continue
+			}
+
+			for _, dep := range deps {
+				p.files[i_file].outgoing_links = append(p.files[i_file].outgoing_links, dep)
+				p.files[i_file].build_deps = append(p.files[i_file].build_deps, dep)
+				dep.incoming_links = append(dep.incoming_links, &p.files[i_file])
 			}
 		}
 	}
 }
 
+// same_component_dep returns the dep in deps belonging to comp, or nil if
+// none of them do.
+func same_component_dep(deps []*file, comp *component) *file {
+	for _, dep := range deps {
+		if dep.component == comp {
+			return dep
+		}
+	}
+	return nil
+}
+
 func read_files(root_path string, flags log_flags) project {
 	source_suffixes := []string{".cpp", ".hpp", ".c", ".h"}
 	ignore_patterns := []string{".svn", "dev/tools"}
@@ -271,6 +372,7 @@ func read_files(root_path string, flags log_flags) project {
 	root_path = strings.TrimSuffix(root_path, "/")
 
 	project := project{root: root_path}
+	project.ignores = append(project.ignores, load_cppdepignore(project.root)...)
 
 	err := filepath.Walk(project.root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -286,10 +388,16 @@ func read_files(root_path string, flags log_flags) project {
 		if info.Name() == "CMakeLists.txt" {
 			component_path := project.rel_path(strings.TrimSuffix(path, "/CMakeLists.txt"))
 			project.components = append(project.components, component{path: component_path})
+			targets, err := parse_cmakelists(path, component_path)
+			if err != nil {
+				fmt.Printf("error parsing %s: %v\n", path, err)
+			} else {
+				project.cmake_targets = append(project.cmake_targets, targets...)
+			}
 		}
 		for _, suffix := range source_suffixes {
 			if strings.HasSuffix(path, suffix) {
-				include_paths := extract_includes(path, flags)
+				include_paths := extract_includes(path, flags, &project)
 				new_file := file{path: project.rel_path(path), include_paths: include_paths}
 				project.files = append(project.files, new_file)
 			}
@@ -300,20 +408,58 @@ func read_files(root_path string, flags log_flags) project {
 		fmt.Printf("error walking the path %q: %v\n", project.root, err)
 		panic(err)
 	}
+	project.resolve_cmake_include_dirs()
 	return project
 }
 
-func extract_includes(path string, flags log_flags) []string {
+func extract_includes(path string, flags log_flags, proj *project) []string {
+	directives, err := scan_ignore_directives(path)
+	check(err)
+
+	var file_rules []*ignore_rule
+	for _, d := range directives.file_globs {
+		rule := &ignore_rule{kind: "file", pattern: d.pattern, source: fmt.Sprintf("%s:%d", path, d.line)}
+		file_rules = append(file_rules, rule)
+		proj.ignores = append(proj.ignores, rule)
+	}
+	line_rules := make(map[int]*ignore_rule, len(directives.ignore_next_lines))
+	for line_num := range directives.ignore_next_lines {
+		rule := &ignore_rule{kind: "line", source: fmt.Sprintf("%s:%d", path, line_num)}
+		line_rules[line_num] = rule
+		proj.ignores = append(proj.ignores, rule)
+	}
+	var project_rules []*ignore_rule
+	for _, rule := range proj.ignores {
+		if rule.kind == "project" {
+			project_rules = append(project_rules, rule)
+		}
+	}
+
+	preproc_active, err := scan_preprocessor_active(path, flags.macros, flags.strict_preproc)
+	check(err)
+
 	fh, err := os.Open(path)
 	check(err)
 	defer fh.Close()
 
 	var results []string
 
+	line_num := 0
 	r := bufio.NewScanner(bufio.NewReader(fh))
 	for r.Scan() {
+		line_num++
 		if strings.HasPrefix(r.Text(), "#include") {
 			line := r.Text()
+
+			if !preproc_active[line_num] {
+				continue
+			}
+
+			if rule, ignored := line_rules[line_num-1]; ignored {
+				rule.used = true
+				continue
+			}
+
 			iStart := strings.IndexAny(line, "\"<")
 			iEnd := strings.LastIndexAny(line, "\">")
 			if iStart == -1 || iEnd == -1 || iStart >= iEnd {
@@ -329,6 +475,16 @@ func extract_includes(path string, flags log_flags) []string {
 				}
 				continue
 			}
+
+			if rule := match_ignore(file_rules, include_path); rule != nil {
+				rule.used = true
+				continue
+			}
+			if rule := match_ignore(project_rules, include_path); rule != nil {
+				rule.used = true
+				continue
+			}
+
 			results = append(results, include_path)
 		}
 	}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// topological_order returns the project's components ordered so that each
+// component appears after every component it depends on. It first runs
+// Tarjan's strongly connected components algorithm over the component-level
+// dependency graph to find cycles; any SCC containing more than one
+// component is a cycle and is returned alongside the order. Cycles are
+// condensed to a single node each so that a stable order (sorted by
+// component path as a tiebreaker) can still be produced via Kahn's
+// algorithm on the resulting DAG.
+func (p *project) topological_order() ([]*component, [][]*component, error) {
+	comps := make([]*component, len(p.components))
+	for i := range p.components {
+		comps[i] = &p.components[i]
+	}
+
+	sccs := tarjan_scc(comps)
+
+	var cycles [][]*component
+	for _, scc := range sccs {
+		if len(scc) > 1 {
+			cycles = append(cycles, scc)
+		}
+	}
+
+	order, err := condensed_topological_order(comps, sccs)
+	if err != nil {
+		return nil, cycles, err
+	}
+	return order, cycles, nil
+}
+
+// print_cycles reports each cycle found by topological_order, along with
+// the file-to-file edges that participate in it.
+func (p *project) print_cycles(cycles [][]*component) {
+	for _, cycle := range cycles {
+		members := make(map[*component]bool, len(cycle))
+		sorted := make([]*component, len(cycle))
+		copy(sorted, cycle)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].path < sorted[j].path })
+		for _, c := range sorted {
+			members[c] = true
+		}
+
+		names := make([]string, len(sorted))
+		for i, c := range sorted {
+			names[i] = c.nice_name()
+		}
+		fmt.Printf("Cycle: %s\n", strings.Join(names, " -> "))
+
+		for _, c := range sorted {
+			_, out := c.linked_components()
+			for _, dep := range out {
+				if !members[dep.component] {
+					continue
+				}
+				for _, e := range dep.edges {
+					fmt.Printf("  %s -> %s\n", e.from.path, e.to.path)
+				}
+			}
+		}
+	}
+}
+
+// tarjan_scc partitions comps into strongly connected components using
+// Tarjan's algorithm, following the outgoing edges from linked_components().
+func tarjan_scc(comps []*component) [][]*component {
+	w := &tarjan_walker{
+		index:    make(map[*component]int),
+		lowlink:  make(map[*component]int),
+		on_stack: make(map[*component]bool),
+	}
+
+	for _, c := range comps {
+		if _, visited := w.index[c]; !visited {
+			w.strongconnect(c)
+		}
+	}
+	return w.sccs
+}
+
+type tarjan_walker struct {
+	index      map[*component]int
+	lowlink    map[*component]int
+	on_stack   map[*component]bool
+	stack      []*component
+	next_index int
+	sccs       [][]*component
+}
+
+func (w *tarjan_walker) strongconnect(v *component) {
+	w.index[v] = w.next_index
+	w.lowlink[v] = w.next_index
+	w.next_index++
+	w.stack = append(w.stack, v)
+	w.on_stack[v] = true
+
+	for _, succ := range component_neighbors(v) {
+		if _, visited := w.index[succ]; !visited {
+			w.strongconnect(succ)
+			if w.lowlink[succ] < w.lowlink[v] {
+				w.lowlink[v] = w.lowlink[succ]
+			}
+		} else if w.on_stack[succ] {
+			if w.index[succ] < w.lowlink[v] {
+				w.lowlink[v] = w.index[succ]
+			}
+		}
+	}
+
+	if w.lowlink[v] == w.index[v] {
+		var scc []*component
+		for {
+			n := len(w.stack) - 1
+			top := w.stack[n]
+			w.stack = w.stack[:n]
+			w.on_stack[top] = false
+			scc = append(scc, top)
+			if top == v {
+				break
+			}
+		}
+		w.sccs = append(w.sccs, scc)
+	}
+}
+
+// component_neighbors returns the distinct components c depends on.
+// linked_components() already excludes edges back to c itself, so a
+// component can never be its own neighbor here.
+func component_neighbors(c *component) []*component {
+	_, out := c.linked_components()
+	seen := make(map[*component]bool, len(out))
+	neighbors := make([]*component, 0, len(out))
+	for _, dep := range out {
+		if !seen[dep.component] {
+			seen[dep.component] = true
+			neighbors = append(neighbors, dep.component)
+		}
+	}
+	return neighbors
+}
+
+// condensed_topological_order collapses each SCC to a single node and runs
+// Kahn's algorithm over the resulting DAG, expanding each condensed node
+// back into its member components (sorted by path) as it is emitted. Among
+// nodes with no remaining incoming edges, the one whose lowest-path member
+// sorts first is always picked next, giving a stable, deterministic order.
+func condensed_topological_order(comps []*component, sccs [][]*component) ([]*component, error) {
+	scc_id := make(map[*component]int, len(comps))
+	for id, scc := range sccs {
+		for _, c := range scc {
+			scc_id[c] = id
+		}
+	}
+
+	n := len(sccs)
+	adj := make([]map[int]bool, n)
+	indegree := make([]int, n)
+	for i := range adj {
+		adj[i] = make(map[int]bool)
+	}
+
+	// adj[dep_id] holds the SCCs that depend on dep_id, and indegree[id]
+	// counts how many of id's own dependencies haven't been emitted yet, so
+	// that Kahn's algorithm below peels off dependencies before dependents.
+	for _, c := range comps {
+		dependent_id := scc_id[c]
+		for _, neighbor := range component_neighbors(c) {
+			dep_id := scc_id[neighbor]
+			if dependent_id == dep_id || adj[dep_id][dependent_id] {
+				continue
+			}
+			adj[dep_id][dependent_id] = true
+			indegree[dependent_id]++
+		}
+	}
+
+	tiebreaker := make([]string, n)
+	for id, scc := range sccs {
+		min_path := scc[0].path
+		for _, c := range scc[1:] {
+			if c.path < min_path {
+				min_path = c.path
+			}
+		}
+		tiebreaker[id] = min_path
+	}
+
+	done := make([]bool, n)
+	order := make([]*component, 0, len(comps))
+	for processed := 0; processed < n; processed++ {
+		best := -1
+		for id := 0; id < n; id++ {
+			if done[id] || indegree[id] > 0 {
+				continue
+			}
+			if best == -1 || tiebreaker[id] < tiebreaker[best] {
+				best = id
+			}
+		}
+		if best == -1 {
+			return order, fmt.Errorf("cppdep: condensation graph still has a cycle, this is a bug")
+		}
+
+		done[best] = true
+		members := make([]*component, len(sccs[best]))
+		copy(members, sccs[best])
+		sort.Slice(members, func(i, j int) bool { return members[i].path < members[j].path })
+		order = append(order, members...)
+
+		for to := range adj[best] {
+			indegree[to]--
+		}
+	}
+	return order, nil
+}
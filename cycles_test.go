@@ -0,0 +1,149 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// build_test_project creates one file per named component and wires
+// cross-component file edges for each "from->to" pair in edges, mirroring
+// what generate_file_deps would have produced.
+func build_test_project(names []string, edges [][2]string) *project {
+	p := &project{}
+	p.components = make([]component, len(names))
+	for i, name := range names {
+		p.components[i] = component{path: name}
+	}
+
+	files := make(map[string]*file, len(names))
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[name] = i
+	}
+	for _, name := range names {
+		f := &file{path: name + "/" + name + ".cpp", component: &p.components[index[name]]}
+		files[name] = f
+		p.components[index[name]].files = append(p.components[index[name]].files, f)
+	}
+
+	for _, e := range edges {
+		from, to := files[e[0]], files[e[1]]
+		from.outgoing_links = append(from.outgoing_links, to)
+		to.incoming_links = append(to.incoming_links, from)
+	}
+	return p
+}
+
+func component_names(comps []*component) []string {
+	names := make([]string, len(comps))
+	for i, c := range comps {
+		names[i] = c.path
+	}
+	return names
+}
+
+func TestTopologicalOrderAcyclic(t *testing.T) {
+	cases := []struct {
+		name  string
+		names []string
+		edges [][2]string
+		want  []string
+	}{
+		{
+			name:  "chain",
+			names: []string{"a", "b", "c"},
+			edges: [][2]string{{"a", "b"}, {"b", "c"}},
+			want:  []string{"c", "b", "a"},
+		},
+		{
+			name:  "diamond",
+			names: []string{"a", "b", "c", "d"},
+			edges: [][2]string{{"a", "b"}, {"a", "c"}, {"b", "d"}, {"c", "d"}},
+			want:  []string{"d", "b", "c", "a"},
+		},
+		{
+			name:  "independent components tiebreak by path",
+			names: []string{"b", "a"},
+			edges: nil,
+			want:  []string{"a", "b"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := build_test_project(tc.names, tc.edges)
+			order, cycles, err := p.topological_order()
+			if err != nil {
+				t.Fatalf("topological_order() error = %v", err)
+			}
+			if len(cycles) != 0 {
+				t.Fatalf("topological_order() cycles = %v, want none", cycles)
+			}
+			got := component_names(order)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("topological_order() order = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTopologicalOrderCycle(t *testing.T) {
+	p := build_test_project([]string{"a", "b", "c"}, [][2]string{
+		{"a", "b"}, {"b", "a"}, // a <-> b cycle
+		{"b", "c"},
+	})
+
+	order, cycles, err := p.topological_order()
+	if err != nil {
+		t.Fatalf("topological_order() error = %v", err)
+	}
+	if len(cycles) != 1 {
+		t.Fatalf("topological_order() cycles = %v, want exactly one", cycles)
+	}
+	got_cycle := component_names(cycles[0])
+	sorted_cycle := append([]string{}, got_cycle...)
+	want_cycle := []string{"a", "b"}
+	if len(sorted_cycle) != len(want_cycle) {
+		t.Fatalf("cycle members = %v, want %v", sorted_cycle, want_cycle)
+	}
+	for _, name := range want_cycle {
+		found := false
+		for _, g := range sorted_cycle {
+			if g == name {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("cycle members = %v, missing %q", sorted_cycle, name)
+		}
+	}
+
+	// c has no dependencies and isn't part of the cycle, so it's always
+	// emitted first regardless of how the condensed a/b node sorts.
+	got := component_names(order)
+	if got[0] != "c" {
+		t.Errorf("topological_order() order = %v, want c first", got)
+	}
+}
+
+func TestTopologicalOrderThreeWayCycle(t *testing.T) {
+	p := build_test_project([]string{"a", "b", "c", "d"}, [][2]string{
+		{"a", "b"}, {"b", "c"}, {"c", "a"}, // a -> b -> c -> a
+		{"a", "d"},
+	})
+
+	order, cycles, err := p.topological_order()
+	if err != nil {
+		t.Fatalf("topological_order() error = %v", err)
+	}
+	if len(cycles) != 1 || len(cycles[0]) != 3 {
+		t.Fatalf("topological_order() cycles = %v, want one 3-member cycle", cycles)
+	}
+
+	// d has no dependencies and isn't part of the cycle, so it's always
+	// emitted before the condensed a/b/c node.
+	got := component_names(order)
+	if got[0] != "d" {
+		t.Errorf("topological_order() order = %v, want d first", got)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// print_dot renders the component-level dependency graph as GraphViz DOT:
+// one node per component, sized by its file count, with edges weighted by
+// how many file-to-file includes back them. With flags.cluster, components
+// sharing a top-level directory are grouped into a subgraph cluster. As in
+// the text and JSON output, a component-filter argument only suppresses an
+// edge crossing out of the filtered set when the matching -show-incoming/
+// -show-outgoing flag isn't also given.
+func (p *project) print_dot(flags log_flags) {
+	fmt.Println("digraph cppdep {")
+	fmt.Println("  rankdir=LR;")
+	fmt.Println("  node [shape=box];")
+
+	if flags.cluster {
+		print_dot_clustered_nodes(p, flags)
+	} else {
+		for _, c := range p.components {
+			if should_print_component(c, flags.components) {
+				print_dot_node(c)
+			}
+		}
+	}
+
+	seen := make(map[[2]string]bool)
+	print_dot_edge := func(from, to *component, edges []edge) {
+		key := [2]string{from.nice_name(), to.nice_name()}
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		fmt.Printf("  %q -> %q [penwidth=%.2f];\n", from.nice_name(), to.nice_name(), edge_weight(len(edges)))
+	}
+	for i := range p.components {
+		c := &p.components[i]
+		if !should_print_component(*c, flags.components) {
+			continue
+		}
+		in, out := c.linked_components()
+		for _, dep := range out {
+			if should_print_component(*dep.component, flags.components) || flags.show_outgoing {
+				print_dot_edge(c, dep.component, dep.edges)
+			}
+		}
+		for _, dep := range in {
+			if !should_print_component(*dep.component, flags.components) && flags.show_incoming {
+				print_dot_edge(dep.component, c, dep.edges)
+			}
+		}
+	}
+
+	fmt.Println("}")
+}
+
+func print_dot_node(c component) {
+	fmt.Printf("  %q [label=%q, width=%.2f];\n", c.nice_name(), c.nice_name(), node_size(len(c.files)))
+}
+
+// print_dot_clustered_nodes groups component nodes into a "subgraph
+// cluster_N" per top-level directory; components sharing no directory with
+// any sibling (or living at the project root) are emitted ungrouped.
+func print_dot_clustered_nodes(p *project, flags log_flags) {
+	groups := make(map[string][]component)
+	var tops []string
+	for _, c := range p.components {
+		if !should_print_component(c, flags.components) {
+			continue
+		}
+		top := top_level_dir(c.path)
+		if _, seen := groups[top]; !seen {
+			tops = append(tops, top)
+		}
+		groups[top] = append(groups[top], c)
+	}
+	sort.Strings(tops)
+
+	cluster_id := 0
+	for _, top := range tops {
+		members := groups[top]
+		if top == "" || len(members) < 2 {
+			for _, c := range members {
+				print_dot_node(c)
+			}
+			continue
+		}
+		fmt.Printf("  subgraph cluster_%d {\n", cluster_id)
+		fmt.Printf("    label=%q;\n", top)
+		for _, c := range members {
+			fmt.Print("  ")
+			print_dot_node(c)
+		}
+		fmt.Println("  }")
+		cluster_id++
+	}
+}
+
+func top_level_dir(component_path string) string {
+	if idx := strings.Index(component_path, "/"); idx != -1 {
+		return component_path[:idx]
+	}
+	return component_path
+}
+
+func node_size(num_files int) float64 {
+	return 0.75 + 0.15*float64(num_files)
+}
+
+func edge_weight(num_edges int) float64 {
+	weight := 1.0 + 0.3*float64(num_edges)
+	if weight > 6 {
+		return 6
+	}
+	return weight
+}
+
+// print_dot_files renders the file-level dependency graph: one node per
+// file belonging to a selected component, with an edge for every direct
+// outgoing_links include. A component-filter argument only suppresses an
+// edge crossing out of the filtered set when the matching -show-incoming/
+// -show-outgoing flag isn't also given.
+func (p *project) print_dot_files(flags log_flags) {
+	fmt.Println("digraph cppdep {")
+	fmt.Println("  rankdir=LR;")
+	fmt.Println("  node [shape=box];")
+
+	included := make(map[*file]bool)
+	for i := range p.files {
+		f := &p.files[i]
+		if f.component != nil && should_print_component(*f.component, flags.components) {
+			included[f] = true
+			fmt.Printf("  %q;\n", f.path)
+		}
+	}
+
+	seen := make(map[[2]string]bool)
+	print_dot_file_edge := func(from, to *file) {
+		key := [2]string{from.path, to.path}
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		fmt.Printf("  %q -> %q;\n", from.path, to.path)
+	}
+	for f := range included {
+		for _, dep := range f.outgoing_links {
+			if included[dep] || flags.show_outgoing {
+				print_dot_file_edge(f, dep)
+			}
+		}
+		for _, inc := range f.incoming_links {
+			if !included[inc] && flags.show_incoming {
+				print_dot_file_edge(inc, f)
+			}
+		}
+	}
+
+	fmt.Println("}")
+}
+
+type json_edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type json_dependency struct {
+	Component string      `json:"component"`
+	Edges     []json_edge `json:"edges,omitempty"`
+}
+
+type json_component struct {
+	Path     string            `json:"path"`
+	Files    []string          `json:"files"`
+	Incoming []json_dependency `json:"incoming"`
+	Outgoing []json_dependency `json:"outgoing"`
+}
+
+type json_report struct {
+	Components []json_component `json:"components"`
+}
+
+// print_json renders the dependency graph as JSON. File-to-file edge
+// detail is only included when -show-incoming/-show-outgoing ask for it,
+// matching the text output.
+func (p *project) print_json(flags log_flags) {
+	var report json_report
+	for _, c := range p.components {
+		if !should_print_component(c, flags.components) {
+			continue
+		}
+		in, out := c.linked_components()
+		sort.Slice(in, func(i, j int) bool { return in[i].component.path < in[j].component.path })
+		sort.Slice(out, func(i, j int) bool { return out[i].component.path < out[j].component.path })
+
+		files := make([]string, len(c.files))
+		for i, f := range c.files {
+			files[i] = f.path
+		}
+
+		jc := json_component{
+			Path:     c.nice_name(),
+			Files:    files,
+			Incoming: make([]json_dependency, 0, len(in)),
+			Outgoing: make([]json_dependency, 0, len(out)),
+		}
+		for _, dep := range in {
+			jd := json_dependency{Component: dep.component.nice_name()}
+			if flags.show_incoming {
+				jd.Edges = edges_to_json(dep.edges)
+			}
+			jc.Incoming = append(jc.Incoming, jd)
+		}
+		for _, dep := range out {
+			jd := json_dependency{Component: dep.component.nice_name()}
+			if flags.show_outgoing {
+				jd.Edges = edges_to_json(dep.edges)
+			}
+			jc.Outgoing = append(jc.Outgoing, jd)
+		}
+		report.Components = append(report.Components, jc)
+	}
+
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cppdep: %v\n", err)
+		return
+	}
+	fmt.Println(string(encoded))
+}
+
+func edges_to_json(edges []edge) []json_edge {
+	result := make([]json_edge, len(edges))
+	for i, e := range edges {
+		result[i] = json_edge{From: e.from.path, To: e.to.path}
+	}
+	return result
+}
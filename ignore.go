@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ignore_next_directive = "cppdep:ignore next"
+	file_ignore_prefix    = "cppdep:file-ignore "
+	cppdepignore_filename = ".cppdepignore"
+)
+
+// ignore_rule is a single suppression request: project-wide (loaded from
+// .cppdepignore), file-wide (a "cppdep:file-ignore <glob>" comment), or for
+// exactly the next #include (a "cppdep:ignore next" comment). A rule that
+// never matches an actual include is reported by print_unused_ignores so
+// stale directives can be cleaned up.
+type ignore_rule struct {
+	kind    string // "project", "file", or "line"
+	pattern string // glob pattern; unused for "line"
+	source  string // human-readable origin, e.g. "a/b.cpp:12"
+	used    bool
+}
+
+// print_unused_ignores reports ignore directives that never suppressed an
+// include, so stale entries can be cleaned up. Written to stderr so it
+// never corrupts a machine-readable -format=json/dot payload on stdout.
+func (p *project) print_unused_ignores() {
+	for _, rule := range p.ignores {
+		if rule.used {
+			continue
+		}
+		switch rule.kind {
+		case "line":
+			fmt.Fprintf(os.Stderr, "unused ignore at %s: %q never matched an include\n", rule.source, ignore_next_directive)
+		default:
+			fmt.Fprintf(os.Stderr, "unused ignore at %s: pattern %q never matched an include\n", rule.source, rule.pattern)
+		}
+	}
+}
+
+// load_cppdepignore reads project-level ignore globs from a .cppdepignore
+// file at the project root, if one exists. Each non-blank, non-comment
+// line is a glob pattern matched against include paths, such as "StdAfx.h"
+// or a third-party umbrella header.
+func load_cppdepignore(root_path string) []*ignore_rule {
+	fh, err := os.Open(filepath.Join(root_path, cppdepignore_filename))
+	if err != nil {
+		return nil
+	}
+	defer fh.Close()
+
+	var rules []*ignore_rule
+	line_num := 0
+	r := bufio.NewScanner(bufio.NewReader(fh))
+	for r.Scan() {
+		line_num++
+		pattern := strings.TrimSpace(r.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		rules = append(rules, &ignore_rule{
+			kind:    "project",
+			pattern: pattern,
+			source:  fmt.Sprintf("%s:%d", cppdepignore_filename, line_num),
+		})
+	}
+	return rules
+}
+
+// match_ignore returns the first rule whose glob pattern matches either the
+// full include path or its base name, or nil if none match.
+func match_ignore(rules []*ignore_rule, include_path string) *ignore_rule {
+	base := filepath.Base(include_path)
+	for _, rule := range rules {
+		if glob_match(rule.pattern, include_path) || glob_match(rule.pattern, base) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func glob_match(pattern, name string) bool {
+	ok, err := filepath.Match(pattern, name)
+	return err == nil && ok
+}
+
+// file_ignore_directives holds the cppdep:* comment directives found while
+// scanning a single source file.
+type file_ignore_directives struct {
+	file_globs        []ignore_glob_directive
+	ignore_next_lines map[int]bool
+}
+
+type ignore_glob_directive struct {
+	pattern string
+	line    int
+}
+
+// scan_ignore_directives reads path once to collect its cppdep:ignore and
+// cppdep:file-ignore comments before the real include-extraction pass runs,
+// so a file-ignore glob suppresses matching includes anywhere in the file
+// regardless of where the comment appears relative to them.
+func scan_ignore_directives(path string) (file_ignore_directives, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return file_ignore_directives{}, err
+	}
+	defer fh.Close()
+
+	directives := file_ignore_directives{ignore_next_lines: make(map[int]bool)}
+	line_num := 0
+	r := bufio.NewScanner(bufio.NewReader(fh))
+	for r.Scan() {
+		line_num++
+		comment := line_comment(r.Text())
+		switch {
+		case comment == ignore_next_directive:
+			directives.ignore_next_lines[line_num] = true
+		case strings.HasPrefix(comment, file_ignore_prefix):
+			pattern := strings.TrimSpace(strings.TrimPrefix(comment, file_ignore_prefix))
+			if pattern != "" {
+				directives.file_globs = append(directives.file_globs,
+					ignore_glob_directive{pattern: pattern, line: line_num})
+			}
+		}
+	}
+	return directives, r.Err()
+}
+
+// line_comment returns the text following "//" on a line, trimmed, or ""
+// if the line has no line comment.
+func line_comment(line string) string {
+	idx := strings.Index(line, "//")
+	if idx == -1 {
+		return ""
+	}
+	return strings.TrimSpace(line[idx+2:])
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// source_exts are the file suffixes that compile down to an object file and
+// therefore get a rule of their own in -format=make output. Headers only
+// ever appear as prerequisites.
+var source_exts = []string{".cpp", ".c"}
+
+func is_source_file(path string) bool {
+	for _, ext := range source_exts {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// print_make emits one Makefile rule per source file, of the form
+//
+//	path/to/file.o: path/to/file.cpp header1.hpp header2.hpp
+//
+// using outgoing_links as the prerequisite list. This lets cppdep feed
+// directly into Make/Ninja builds instead of only reporting on dependencies.
+func (p *project) print_make(flags log_flags) {
+	files := make([]*file, 0, len(p.files))
+	for i := range p.files {
+		if is_source_file(p.files[i].path) {
+			files = append(files, &p.files[i])
+		}
+	}
+
+	if flags.sort_deps {
+		files = topo_sort_files(files)
+	}
+
+	for _, f := range files {
+		object_path := strings.TrimSuffix(f.path, filepath.Ext(f.path)) + ".o"
+
+		prereqs := make([]string, 0, len(f.build_deps)+1)
+		prereqs = append(prereqs, f.path)
+		for _, dep := range f.make_deps(flags.all_deps) {
+			prereqs = append(prereqs, dep.path)
+		}
+
+		if flags.one_line {
+			fmt.Printf("%s: %s\n", object_path, strings.Join(prereqs, " "))
+			continue
+		}
+
+		fmt.Printf("%s: %s", object_path, prereqs[0])
+		for _, prereq := range prereqs[1:] {
+			fmt.Printf(" \\\n  %s", prereq)
+		}
+		fmt.Println()
+	}
+}
+
+// make_deps returns the prerequisite files for f's make rule: its direct
+// build_deps, or the full transitive closure of header dependencies when
+// all is true.
+func (f *file) make_deps(all bool) []*file {
+	if !all {
+		return f.build_deps
+	}
+
+	seen := make(map[*file]bool)
+	var deps []*file
+	var visit func(*file)
+	visit = func(cur *file) {
+		for _, dep := range cur.build_deps {
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			deps = append(deps, dep)
+			visit(dep)
+		}
+	}
+	visit(f)
+	return deps
+}
+
+// topo_sort_files orders files so that every file's build_deps (the headers
+// it depends on) appear before the file itself, recursing through the full
+// dependency graph even when it reaches files outside the input set. Files
+// participating in a cycle are emitted once their acyclic dependencies are
+// resolved, in encounter order.
+func topo_sort_files(files []*file) []*file {
+	wanted := make(map[*file]bool, len(files))
+	for _, f := range files {
+		wanted[f] = true
+	}
+
+	visited := make(map[*file]bool)
+	in_progress := make(map[*file]bool)
+	order := make([]*file, 0, len(files))
+
+	var visit func(*file)
+	visit = func(f *file) {
+		if visited[f] || in_progress[f] {
+			return
+		}
+		in_progress[f] = true
+		for _, dep := range f.build_deps {
+			visit(dep)
+		}
+		in_progress[f] = false
+		visited[f] = true
+		if wanted[f] {
+			order = append(order, f)
+		}
+	}
+
+	for _, f := range files {
+		visit(f)
+	}
+	return order
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// tri is a three-valued logic result for a preprocessor condition: it may
+// be definitely true, definitely false, or unknown when it depends on a
+// macro that wasn't supplied via -D.
+type tri int
+
+const (
+	tri_false tri = iota
+	tri_true
+	tri_unknown
+)
+
+// macro_flag collects repeated "-D name[=value]" flags into a macro set.
+// Absence from the set means "unknown", not "undefined" - see
+// scan_preprocessor_active.
+type macro_flag struct {
+	values map[string]string
+}
+
+func (m *macro_flag) String() string {
+	return ""
+}
+
+func (m *macro_flag) Set(arg string) error {
+	if m.values == nil {
+		m.values = make(map[string]string)
+	}
+	name, value := arg, "1"
+	if idx := strings.Index(arg, "="); idx != -1 {
+		name, value = arg[:idx], arg[idx+1:]
+	}
+	m.values[name] = value
+	return nil
+}
+
+// preproc_frame tracks one #if/#elif/#else/#endif chain while scanning a
+// file: whether an earlier branch in the chain was definitely taken
+// (resolved), whether an earlier branch's truth was unknown (had_unknown),
+// and whether code directly inside the current branch is reachable.
+type preproc_frame struct {
+	resolved    bool
+	had_unknown bool
+	active      bool
+}
+
+// next_branch advances frame to a new #if/#elif/#else branch whose own
+// condition evaluates to own_state, and reports whether that branch is
+// active. Once an earlier sibling was definitely taken, every later one is
+// inactive; once an earlier sibling was unknown, later ones stay unknown
+// too, since we can't rule out that the unknown one was actually selected.
+func next_branch(frame *preproc_frame, own_state tri, strict bool) {
+	var effective tri
+	switch {
+	case frame.resolved:
+		effective = tri_false
+	case frame.had_unknown:
+		effective = tri_unknown
+	default:
+		effective = own_state
+	}
+	frame.active = branch_active(effective, strict)
+
+	switch own_state {
+	case tri_true:
+		frame.resolved = true
+	case tri_unknown:
+		frame.had_unknown = true
+	}
+}
+
+// branch_active turns a branch's tri-state into a go/no-go decision. An
+// unknown branch is conservatively kept unless -strict-preproc asked to
+// drop anything that can't be proven.
+func branch_active(state tri, strict bool) bool {
+	switch state {
+	case tri_true:
+		return true
+	case tri_unknown:
+		return !strict
+	default:
+		return false
+	}
+}
+
+// scan_preprocessor_active reads path once and reports, for each line
+// number, whether it lies within a truthy #if/#ifdef/#ifndef/#elif/#else
+// chain given macros. Lines outside any conditional, or not reached by the
+// scanner at all, default to active.
+func scan_preprocessor_active(path string, macros map[string]string, strict bool) (map[int]bool, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	active := make(map[int]bool)
+	var stack []preproc_frame
+
+	enclosing_active := func() bool {
+		for _, frame := range stack {
+			if !frame.active {
+				return false
+			}
+		}
+		return true
+	}
+
+	line_num := 0
+	r := bufio.NewScanner(bufio.NewReader(fh))
+	for r.Scan() {
+		line_num++
+		directive, arg := preproc_directive(r.Text())
+
+		switch directive {
+		case "if", "ifdef", "ifndef":
+			active[line_num] = enclosing_active()
+			expr := arg
+			switch directive {
+			case "ifdef":
+				expr = "defined(" + arg + ")"
+			case "ifndef":
+				expr = "!defined(" + arg + ")"
+			}
+			frame := preproc_frame{}
+			next_branch(&frame, eval_preproc_condition(expr, macros), strict)
+			stack = append(stack, frame)
+
+		case "elif":
+			active[line_num] = enclosing_active()
+			if len(stack) > 0 {
+				next_branch(&stack[len(stack)-1], eval_preproc_condition(arg, macros), strict)
+			}
+
+		case "else":
+			active[line_num] = enclosing_active()
+			if len(stack) > 0 {
+				next_branch(&stack[len(stack)-1], tri_true, strict)
+			}
+
+		case "endif":
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			active[line_num] = enclosing_active()
+
+		default:
+			active[line_num] = enclosing_active()
+		}
+	}
+	return active, r.Err()
+}
+
+// preproc_directive splits a line into a preprocessor directive keyword
+// ("if", "ifdef", "ifndef", "elif", "else", "endif") and its argument, or
+// returns "" if the line isn't one of those directives.
+func preproc_directive(line string) (string, string) {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "#") {
+		return "", ""
+	}
+	trimmed = strings.TrimSpace(trimmed[1:])
+
+	for _, keyword := range []string{"ifdef", "ifndef", "elif", "if", "else", "endif"} {
+		if trimmed == keyword {
+			return keyword, ""
+		}
+		if strings.HasPrefix(trimmed, keyword+" ") || strings.HasPrefix(trimmed, keyword+"\t") {
+			return keyword, strings.TrimSpace(trimmed[len(keyword):])
+		}
+	}
+	return "", ""
+}
+
+// eval_preproc_condition evaluates a single #if/#elif expression against
+// macros. It only understands "defined(NAME)", bare "NAME", and
+// "NAME == value"/"NAME != value" comparisons, each optionally negated with
+// a leading "!" - real C++ preprocessor expressions can be arbitrarily
+// complex, but this covers the platform-guard patterns cppdep needs to
+// resolve. Compound "&&"/"||" expressions and any macro missing from
+// macros evaluate to tri_unknown.
+func eval_preproc_condition(expr string, macros map[string]string) tri {
+	expr = strings.TrimSpace(expr)
+
+	negate := false
+	for strings.HasPrefix(expr, "!") {
+		negate = !negate
+		expr = strings.TrimSpace(expr[1:])
+	}
+
+	var result tri
+	switch {
+	case strings.HasPrefix(expr, "defined(") && strings.HasSuffix(expr, ")"):
+		result = macro_defined(macros, strings.TrimSpace(expr[len("defined("):len(expr)-1]))
+	case strings.HasPrefix(expr, "defined "):
+		result = macro_defined(macros, strings.TrimSpace(expr[len("defined "):]))
+	case strings.ContainsAny(expr, "&|"):
+		result = tri_unknown
+	case strings.Contains(expr, "=="):
+		result = macro_compare(macros, expr, "==")
+	case strings.Contains(expr, "!="):
+		result = macro_compare(macros, expr, "!=")
+	default:
+		result = macro_truthy(macros, expr)
+	}
+
+	if negate {
+		result = negate_tri(result)
+	}
+	return result
+}
+
+func negate_tri(state tri) tri {
+	switch state {
+	case tri_true:
+		return tri_false
+	case tri_false:
+		return tri_true
+	default:
+		return tri_unknown
+	}
+}
+
+func macro_defined(macros map[string]string, name string) tri {
+	if _, ok := macros[name]; ok {
+		return tri_true
+	}
+	return tri_unknown
+}
+
+func macro_truthy(macros map[string]string, name string) tri {
+	value, ok := macros[name]
+	if !ok {
+		return tri_unknown
+	}
+	if value == "0" {
+		return tri_false
+	}
+	return tri_true
+}
+
+func macro_compare(macros map[string]string, expr string, op string) tri {
+	parts := strings.SplitN(expr, op, 2)
+	if len(parts) != 2 {
+		return tri_unknown
+	}
+	name := strings.TrimSpace(parts[0])
+	want := strings.Trim(strings.TrimSpace(parts[1]), `"`)
+
+	value, ok := macros[name]
+	if !ok {
+		return tri_unknown
+	}
+	equal := value == want
+	if op == "!=" {
+		equal = !equal
+	}
+	if equal {
+		return tri_true
+	}
+	return tri_false
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEvalPreprocCondition(t *testing.T) {
+	macros := map[string]string{"FOO": "1", "ZERO": "0", "NAME": "linux"}
+
+	cases := []struct {
+		expr string
+		want tri
+	}{
+		{"defined(FOO)", tri_true},
+		{"defined(BAR)", tri_unknown},
+		{"!defined(FOO)", tri_false},
+		{"!defined(BAR)", tri_unknown},
+		{"FOO", tri_true},
+		{"ZERO", tri_false},
+		{"BAR", tri_unknown},
+		{"NAME == \"linux\"", tri_true},
+		{"NAME == \"win32\"", tri_false},
+		{"NAME != \"win32\"", tri_true},
+		{"UNKNOWN == \"x\"", tri_unknown},
+		{"FOO && defined(BAR)", tri_unknown},
+		{"FOO || defined(BAR)", tri_unknown},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			if got := eval_preproc_condition(tc.expr, macros); got != tc.want {
+				t.Errorf("eval_preproc_condition(%q) = %v, want %v", tc.expr, got, tc.want)
+			}
+		})
+	}
+}
+
+func write_temp_file(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.hpp")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestScanPreprocessorActive(t *testing.T) {
+	const src = `line 1
+#ifdef FOO
+line 3 active
+#else
+line 5 inactive
+#endif
+#ifdef BAR
+line 8 unknown but kept
+#endif
+#if defined(FOO) && defined(BAR)
+line 11 unknown but kept
+#endif
+line 13
+`
+	path := write_temp_file(t, src)
+
+	active, err := scan_preprocessor_active(path, map[string]string{"FOO": "1"}, false)
+	if err != nil {
+		t.Fatalf("scan_preprocessor_active: %v", err)
+	}
+	want := map[int]bool{3: true, 5: false, 8: true, 11: true, 13: true}
+	for line, want_active := range want {
+		if active[line] != want_active {
+			t.Errorf("line %d: active = %v, want %v", line, active[line], want_active)
+		}
+	}
+}
+
+func TestScanPreprocessorActiveStrict(t *testing.T) {
+	const src = `#ifdef BAR
+line 2 unknown branch, dropped under -strict-preproc
+#endif
+line 4
+`
+	path := write_temp_file(t, src)
+
+	active, err := scan_preprocessor_active(path, map[string]string{}, true)
+	if err != nil {
+		t.Fatalf("scan_preprocessor_active: %v", err)
+	}
+	if active[2] {
+		t.Errorf("line 2: active = true, want false under -strict-preproc")
+	}
+	if !active[4] {
+		t.Errorf("line 4: active = false, want true (outside the conditional)")
+	}
+}
+
+func TestScanPreprocessorActiveElifChain(t *testing.T) {
+	const src = `#if A
+line 2
+#elif B
+line 4
+#else
+line 6
+#endif
+`
+	path := write_temp_file(t, src)
+
+	// A is known to be falsy (0), B is known to be truthy: the #if branch
+	// is definitely skipped and the #elif branch is definitely taken, so
+	// the #else is definitely dead.
+	active, err := scan_preprocessor_active(path, map[string]string{"A": "0", "B": "1"}, false)
+	if err != nil {
+		t.Fatalf("scan_preprocessor_active: %v", err)
+	}
+	want := map[int]bool{2: false, 4: true, 6: false}
+	got := map[int]bool{2: active[2], 4: active[4], 6: active[6]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("elif chain active = %v, want %v", got, want)
+	}
+
+	// Neither macro is supplied at all: every branch is unknown, and since
+	// an unknown branch is conservatively kept, all three stay active.
+	active, err = scan_preprocessor_active(path, map[string]string{}, false)
+	if err != nil {
+		t.Fatalf("scan_preprocessor_active: %v", err)
+	}
+	want = map[int]bool{2: true, 4: true, 6: true}
+	got = map[int]bool{2: active[2], 4: active[4], 6: active[6]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("elif chain (all unknown) active = %v, want %v", got, want)
+	}
+}
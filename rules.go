@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// layering_rule is one allow/deny verdict for edges whose source and
+// destination component paths match the given glob patterns, e.g. "deny
+// core -> ui" or "allow *_test -> *".
+type layering_rule struct {
+	action string // "allow" or "deny"
+	from   string // glob over the dependent component's path
+	to     string // glob over the dependency's path
+}
+
+// layering_config is a parsed -rules file: an ordered list of rules plus
+// whether unmatched edges default to denied (deny-by-default) or allowed.
+type layering_config struct {
+	rules           []layering_rule
+	deny_by_default bool
+}
+
+// load_layering_rules reads a layering rules file in the following YAML
+// subset:
+//
+//	deny_by_default: true
+//	rules:
+//	  - action: deny
+//	    from: core
+//	    to: ui
+//	  - action: allow
+//	    from: "*_test"
+//	    to: "*"
+//
+// Rules are matched in list order; the first match wins. "#" starts a
+// comment anywhere outside a quoted value.
+func load_layering_rules(path string) (layering_config, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return layering_config{}, err
+	}
+	defer fh.Close()
+
+	var cfg layering_config
+	var cur map[string]string
+
+	flush := func() error {
+		if cur == nil {
+			return nil
+		}
+		action := strings.ToLower(cur["action"])
+		if action != "allow" && action != "deny" {
+			return fmt.Errorf("%s: rule missing a valid \"action\" (allow/deny): %v", path, cur)
+		}
+		from, to := cur["from"], cur["to"]
+		if from == "" || to == "" {
+			return fmt.Errorf("%s: rule missing \"from\"/\"to\": %v", path, cur)
+		}
+		cfg.rules = append(cfg.rules, layering_rule{action: action, from: from, to: to})
+		cur = nil
+		return nil
+	}
+
+	line_num := 0
+	r := bufio.NewScanner(bufio.NewReader(fh))
+	for r.Scan() {
+		line_num++
+		line := strings.TrimSpace(strip_yaml_comment(r.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "- ") {
+			if err := flush(); err != nil {
+				return cfg, err
+			}
+			cur = map[string]string{}
+			if err := parse_yaml_field(cur, strings.TrimPrefix(line, "- "), path, line_num); err != nil {
+				return cfg, err
+			}
+			continue
+		}
+		if line == "rules:" {
+			if err := flush(); err != nil {
+				return cfg, err
+			}
+			continue
+		}
+		if cur != nil {
+			if err := parse_yaml_field(cur, line, path, line_num); err != nil {
+				return cfg, err
+			}
+			continue
+		}
+
+		key, val, err := yaml_key_value(line, path, line_num)
+		if err != nil {
+			return cfg, err
+		}
+		switch key {
+		case "deny_by_default":
+			cfg.deny_by_default = val == "true"
+		default:
+			return cfg, fmt.Errorf("%s:%d: unknown key %q", path, line_num, key)
+		}
+	}
+	if err := flush(); err != nil {
+		return cfg, err
+	}
+	return cfg, r.Err()
+}
+
+func parse_yaml_field(cur map[string]string, line, path string, line_num int) error {
+	key, val, err := yaml_key_value(line, path, line_num)
+	if err != nil {
+		return err
+	}
+	cur[key] = val
+	return nil
+}
+
+func yaml_key_value(line, path string, line_num int) (string, string, error) {
+	idx := strings.Index(line, ":")
+	if idx == -1 {
+		return "", "", fmt.Errorf("%s:%d: malformed line, want \"key: value\": %q", path, line_num, line)
+	}
+	key := strings.TrimSpace(line[:idx])
+	val := strings.Trim(strings.TrimSpace(line[idx+1:]), `"'`)
+	return key, val, nil
+}
+
+func strip_yaml_comment(line string) string {
+	if idx := strings.Index(line, "#"); idx != -1 {
+		return line[:idx]
+	}
+	return line
+}
+
+// edge_allowed applies cfg's rules, in order, to a dependency from the
+// component at from_path on the component at to_path. The first matching
+// rule decides; an unmatched edge falls back to cfg.deny_by_default.
+func (cfg layering_config) edge_allowed(from_path, to_path string) bool {
+	for _, rule := range cfg.rules {
+		if glob_match(rule.from, from_path) && glob_match(rule.to, to_path) {
+			return rule.action == "allow"
+		}
+	}
+	return !cfg.deny_by_default
+}
+
+// layering_violation is one component-to-component edge that cfg forbids,
+// along with the specific file-to-file edges that make it up.
+type layering_violation struct {
+	from  *component
+	to    *component
+	edges []edge
+}
+
+// layering_violations walks every component's outgoing dependencies and
+// reports the ones cfg forbids.
+func (p *project) layering_violations(cfg layering_config) []layering_violation {
+	var violations []layering_violation
+	for i := range p.components {
+		c := &p.components[i]
+		_, out := c.linked_components()
+		sort.Slice(out, func(i, j int) bool { return out[i].component.path < out[j].component.path })
+		for _, dep := range out {
+			if cfg.edge_allowed(c.path, dep.component.path) {
+				continue
+			}
+			violations = append(violations, layering_violation{from: c, to: dep.component, edges: dep.edges})
+		}
+	}
+	return violations
+}
+
+// print_layering_violations reports violations as human-readable text.
+func print_layering_violations(violations []layering_violation) {
+	for _, v := range violations {
+		fmt.Printf("layering violation: %s -> %s\n", v.from.nice_name(), v.to.nice_name())
+		for _, e := range v.edges {
+			fmt.Printf("  %s -> %s\n", e.from.path, e.to.path)
+		}
+	}
+}
+
+type violation_json struct {
+	From  string      `json:"from"`
+	To    string      `json:"to"`
+	Edges []edge_json `json:"edges"`
+}
+
+type edge_json struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// print_layering_violations_json reports violations as JSON, for CI
+// systems that want to post them as review comments.
+func print_layering_violations_json(violations []layering_violation) {
+	report := make([]violation_json, 0, len(violations))
+	for _, v := range violations {
+		edges := make([]edge_json, 0, len(v.edges))
+		for _, e := range v.edges {
+			edges = append(edges, edge_json{From: e.from.path, To: e.to.path})
+		}
+		report = append(report, violation_json{From: v.from.nice_name(), To: v.to.nice_name(), Edges: edges})
+	}
+
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cppdep: %v\n", err)
+		return
+	}
+	fmt.Println(string(encoded))
+}